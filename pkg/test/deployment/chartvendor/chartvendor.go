@@ -0,0 +1,366 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package chartvendor lets test deployments declare the Helm charts they depend on in a
+// Chartfile and materialize them on disk before deployment, similar to how "tk tool charts"
+// vendors Tanka dependencies into a project's vendor directory.
+package chartvendor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/istio/pkg/test/scopes"
+)
+
+// Entry describes a single vendored chart dependency.
+type Entry struct {
+	// Repo is the Helm chart repository index URL, e.g. "https://istio-release.storage.googleapis.com/charts".
+	Repo string `json:"repo"`
+	// Name is the chart name as published in the repo's index.yaml.
+	Name string `json:"name"`
+	// Version is a SemVer constraint (exact version, or a "^"/"~" range) to resolve against the
+	// repo's index. An empty version resolves to the latest stable release.
+	Version string `json:"version"`
+	// Alias is the name this chart is referenced by from HelmConfig.ChartRef. Defaults to Name.
+	Alias string `json:"alias,omitempty"`
+	// Dir is the directory (relative to the Chartfile's VendorDir) the chart is extracted into.
+	// Defaults to Alias.
+	Dir string `json:"dir,omitempty"`
+}
+
+func (e Entry) alias() string {
+	if e.Alias != "" {
+		return e.Alias
+	}
+	return e.Name
+}
+
+func (e Entry) dir() string {
+	if e.Dir != "" {
+		return e.Dir
+	}
+	return e.alias()
+}
+
+// Chartfile is the parsed form of a Chartfile manifest: a declarative list of chart dependencies
+// for a test deployment.
+type Chartfile struct {
+	Charts []Entry `json:"charts"`
+
+	// VendorDir is the directory vendored charts are materialized under. Defaults to the
+	// directory containing the Chartfile on disk.
+	VendorDir string `json:"-"`
+
+	// RepositoryCacheDir, if set, is checked for an already-downloaded chart tarball before
+	// fetching one over the network, and written to after a fresh download. Typically set to a
+	// deployment.HelmEnv's RepositoryCacheDir so repeated deployments share one cache.
+	RepositoryCacheDir string `json:"-"`
+
+	// RepositoryConfigFile, if set, is a repositories.yaml tracking which of Charts' repos have
+	// already been registered, so Vendor only registers a repo the first time it sees it.
+	// Typically set to a deployment.HelmEnv's RepositoryConfigFile. A Chartfile that leaves this
+	// unset simply skips repo registration.
+	RepositoryConfigFile string `json:"-"`
+}
+
+// Load reads and parses the Chartfile at path.
+func Load(path string) (*Chartfile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading chartfile %s: %v", path, err)
+	}
+
+	cf := &Chartfile{}
+	if err := yaml.Unmarshal(b, cf); err != nil {
+		return nil, fmt.Errorf("failed parsing chartfile %s: %v", path, err)
+	}
+	cf.VendorDir = filepath.Dir(path)
+	return cf, nil
+}
+
+// Add declares a new chart dependency. It does not vendor the chart; call Vendor afterward.
+func (c *Chartfile) Add(entry Entry) {
+	c.Charts = append(c.Charts, entry)
+}
+
+// Dir returns the on-disk directory a vendored chart was (or will be) extracted into, given its
+// alias.
+func (c *Chartfile) Dir(alias string) string {
+	for _, e := range c.Charts {
+		if e.alias() == alias {
+			return filepath.Join(c.VendorDir, e.dir())
+		}
+	}
+	return ""
+}
+
+// Vendor downloads and extracts every declared chart dependency under VendorDir. Charts that are
+// already extracted are left untouched.
+func (c *Chartfile) Vendor(ctx context.Context) error {
+	if c.VendorDir == "" {
+		return fmt.Errorf("chartvendor: VendorDir must be set before calling Vendor")
+	}
+
+	indexes := map[string]*repo.IndexFile{}
+	for _, e := range c.Charts {
+		if err := registerRepo(c.RepositoryConfigFile, e.Repo); err != nil {
+			return fmt.Errorf("failed registering repo %s: %v", e.Repo, err)
+		}
+
+		idx, ok := indexes[e.Repo]
+		if !ok {
+			var err error
+			if idx, err = fetchIndex(ctx, e.Repo); err != nil {
+				return fmt.Errorf("failed fetching index for repo %s: %v", e.Repo, err)
+			}
+			indexes[e.Repo] = idx
+		}
+
+		if err := c.vendorEntry(ctx, e, idx); err != nil {
+			return fmt.Errorf("failed vendoring chart %s: %v", e.alias(), err)
+		}
+	}
+	return nil
+}
+
+func (c *Chartfile) vendorEntry(ctx context.Context, e Entry, idx *repo.IndexFile) error {
+	targetDir := filepath.Join(c.VendorDir, e.dir())
+	if _, err := loader.LoadDir(targetDir); err == nil {
+		scopes.CI.Infof("Chart %s already vendored at %s, skipping", e.alias(), targetDir)
+		return nil
+	}
+
+	cv, err := resolveVersion(idx, e.Name, e.Version)
+	if err != nil {
+		return err
+	}
+	if len(cv.URLs) == 0 {
+		return fmt.Errorf("no download URL for chart %s version %s", e.Name, cv.Version)
+	}
+
+	tgz, err := c.fetchTarball(ctx, e.Name, cv)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyDigest(tgz, cv.Digest); err != nil {
+		return fmt.Errorf("%s %s: %v", e.Name, cv.Version, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(targetDir), os.ModePerm); err != nil {
+		return err
+	}
+	extractDir, err := ioutil.TempDir(c.VendorDir, ".chartvendor-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(extractDir)
+
+	chrt, err := loader.LoadArchive(bytes.NewReader(tgz))
+	if err != nil {
+		return fmt.Errorf("failed loading chart archive for %s: %v", e.Name, err)
+	}
+	if err := chartutil.SaveDir(chrt, extractDir); err != nil {
+		return fmt.Errorf("failed extracting chart archive for %s: %v", e.Name, err)
+	}
+
+	scopes.CI.Infof("Vendored chart %s %s into %s", e.Name, cv.Version, targetDir)
+	return os.Rename(filepath.Join(extractDir, chrt.Metadata.Name), targetDir)
+}
+
+// fetchTarball returns the chart tarball for cv, reading it from RepositoryCacheDir if it was
+// already downloaded there (the download is skipped entirely in that case), and writing a copy to
+// RepositoryCacheDir after a fresh download otherwise.
+func (c *Chartfile) fetchTarball(ctx context.Context, name string, cv *repo.ChartVersion) ([]byte, error) {
+	if c.RepositoryCacheDir == "" {
+		return download(ctx, cv.URLs[0])
+	}
+
+	cachePath := filepath.Join(c.RepositoryCacheDir, fmt.Sprintf("%s-%s.tgz", name, cv.Version))
+	if b, err := ioutil.ReadFile(cachePath); err == nil {
+		scopes.CI.Infof("Using cached chart tarball for %s %s", name, cv.Version)
+		return b, nil
+	}
+
+	tgz, err := download(ctx, cv.URLs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(c.RepositoryCacheDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed creating chart cache dir %s: %v", c.RepositoryCacheDir, err)
+	}
+	if err := ioutil.WriteFile(cachePath, tgz, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed caching chart tarball at %s: %v", cachePath, err)
+	}
+	return tgz, nil
+}
+
+// repositoryConfig is a minimal analog of Helm's own repositories.yaml: the set of chart repo
+// URLs already known to a HelmEnv, so Vendor never re-registers a repo it has already seen.
+type repositoryConfig struct {
+	Repositories []repositoryEntry `json:"repositories"`
+}
+
+type repositoryEntry struct {
+	URL string `json:"url"`
+}
+
+// registerRepo records repoURL in the repositories.yaml at path if it isn't already present
+// there. It is a no-op when path is empty, so a Chartfile without a RepositoryConfigFile simply
+// skips repo registration.
+func registerRepo(path, repoURL string) error {
+	if path == "" {
+		return nil
+	}
+
+	cfg := &repositoryConfig{}
+	b, err := ioutil.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(b, cfg); err != nil {
+			return fmt.Errorf("failed parsing repository config %s: %v", path, err)
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("failed reading repository config %s: %v", path, err)
+	}
+
+	for _, r := range cfg.Repositories {
+		if r.URL == repoURL {
+			return nil
+		}
+	}
+	cfg.Repositories = append(cfg.Repositories, repositoryEntry{URL: repoURL})
+
+	out, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, out, os.ModePerm)
+}
+
+// verifyDigest checks tgz against want, the sha256 digest recorded for it in a repo index. An
+// empty want (some indexes omit it) skips verification.
+func verifyDigest(tgz []byte, want string) error {
+	if want == "" {
+		return nil
+	}
+	sum := sha256.Sum256(tgz)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("digest mismatch: want %s, got %s", want, got)
+	}
+	return nil
+}
+
+// resolveVersion picks the chart version in idx matching constraint, supporting exact versions as
+// well as "^" and "~" SemVer ranges. An empty constraint resolves to the latest stable version,
+// i.e. excluding pre-releases.
+func resolveVersion(idx *repo.IndexFile, name, constraint string) (*repo.ChartVersion, error) {
+	versions, ok := idx.Entries[name]
+	if !ok || len(versions) == 0 {
+		return nil, fmt.Errorf("chart %s not found in repo index", name)
+	}
+
+	if constraint == "" {
+		cv, err := latestStable(versions)
+		if err != nil {
+			return nil, fmt.Errorf("chart %s: %v", name, err)
+		}
+		return cv, nil
+	}
+
+	// NewConstraint also accepts a bare exact version (e.g. "1.2.3"), so this handles both exact
+	// versions and "^"/"~" ranges; there is no separate exact-match path.
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid version constraint %s for chart %s: %v", constraint, name, err)
+	}
+
+	var best *repo.ChartVersion
+	var bestVer *semver.Version
+	for _, cv := range versions {
+		v, err := semver.NewVersion(cv.Version)
+		if err != nil {
+			continue
+		}
+		if c.Check(v) && (bestVer == nil || v.GreaterThan(bestVer)) {
+			best, bestVer = cv, v
+		}
+	}
+	if best != nil {
+		return best, nil
+	}
+	return nil, fmt.Errorf("no version of chart %s satisfies constraint %s", name, constraint)
+}
+
+// latestStable returns the highest version in versions whose SemVer has no pre-release component.
+func latestStable(versions repo.ChartVersions) (*repo.ChartVersion, error) {
+	var best *repo.ChartVersion
+	var bestVer *semver.Version
+	for _, cv := range versions {
+		v, err := semver.NewVersion(cv.Version)
+		if err != nil || v.Prerelease() != "" {
+			continue
+		}
+		if bestVer == nil || v.GreaterThan(bestVer) {
+			best, bestVer = cv, v
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no stable version found")
+	}
+	return best, nil
+}
+
+func fetchIndex(ctx context.Context, repoURL string) (*repo.IndexFile, error) {
+	b, err := download(ctx, strings.TrimSuffix(repoURL, "/")+"/index.yaml")
+	if err != nil {
+		return nil, err
+	}
+	return repo.LoadIndex(b)
+}
+
+func download(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: unexpected status %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
@@ -0,0 +1,132 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package chartvendor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+func newTestIndex() *repo.IndexFile {
+	idx := repo.NewIndexFile()
+	for _, v := range []string{"1.0.0", "1.2.0", "1.2.3", "2.0.0", "3.0.0-rc.1"} {
+		idx.Entries["istio"] = append(idx.Entries["istio"], &repo.ChartVersion{
+			Metadata: &chart.Metadata{Name: "istio", Version: v},
+			URLs:     []string{"https://example.com/istio-" + v + ".tgz"},
+		})
+	}
+	return idx
+}
+
+func TestResolveVersion(t *testing.T) {
+	idx := newTestIndex()
+
+	cases := []struct {
+		name       string
+		constraint string
+		want       string
+		wantErr    bool
+	}{
+		{name: "exact version", constraint: "1.2.3", want: "1.2.3"},
+		{name: "caret range", constraint: "^1.0.0", want: "1.2.3"},
+		{name: "tilde range", constraint: "~1.2.0", want: "1.2.3"},
+		{name: "empty constraint resolves latest stable, skipping pre-releases", constraint: "", want: "2.0.0"},
+		{name: "no matching version", constraint: "^4.0.0", wantErr: true},
+		{name: "unknown exact version", constraint: "9.9.9", wantErr: true},
+		{name: "exact pre-release version can still be requested explicitly", constraint: "3.0.0-rc.1", want: "3.0.0-rc.1"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cv, err := resolveVersion(idx, "istio", tc.constraint)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("resolveVersion(%q): expected error, got version %s", tc.constraint, cv.Version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveVersion(%q): unexpected error: %v", tc.constraint, err)
+			}
+			if cv.Version != tc.want {
+				t.Errorf("resolveVersion(%q) = %s, want %s", tc.constraint, cv.Version, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveVersionUnknownChart(t *testing.T) {
+	idx := newTestIndex()
+	if _, err := resolveVersion(idx, "does-not-exist", ""); err == nil {
+		t.Fatal("resolveVersion: expected error for unknown chart, got nil")
+	}
+}
+
+func TestRegisterRepoSkipsExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "repositories.yaml")
+
+	if err := registerRepo(path, "https://example.com/charts"); err != nil {
+		t.Fatalf("registerRepo: unexpected error on first call: %v", err)
+	}
+	if err := registerRepo(path, "https://example.com/charts"); err != nil {
+		t.Fatalf("registerRepo: unexpected error on second call: %v", err)
+	}
+	if err := registerRepo(path, "https://example.com/other-charts"); err != nil {
+		t.Fatalf("registerRepo: unexpected error registering a second repo: %v", err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed reading repository config: %v", err)
+	}
+	cfg := &repositoryConfig{}
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		t.Fatalf("failed parsing repository config: %v", err)
+	}
+
+	if len(cfg.Repositories) != 2 {
+		t.Fatalf("repository config has %d entries, want 2 (duplicate registration should be a no-op): %+v",
+			len(cfg.Repositories), cfg.Repositories)
+	}
+}
+
+func TestRegisterRepoNoopWithoutPath(t *testing.T) {
+	if err := registerRepo("", "https://example.com/charts"); err != nil {
+		t.Fatalf("registerRepo with empty path: unexpected error: %v", err)
+	}
+}
+
+func TestVerifyDigest(t *testing.T) {
+	data := []byte("fake chart tarball contents")
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+
+	if err := verifyDigest(data, digest); err != nil {
+		t.Errorf("verifyDigest with matching digest: unexpected error: %v", err)
+	}
+	if err := verifyDigest(data, ""); err != nil {
+		t.Errorf("verifyDigest with empty digest: unexpected error: %v", err)
+	}
+	if err := verifyDigest(data, "deadbeef"); err == nil {
+		t.Error("verifyDigest with mismatched digest: expected error, got nil")
+	}
+}
@@ -20,21 +20,20 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/strvals"
+	"sigs.k8s.io/yaml"
+
+	"istio.io/istio/pkg/test/deployment/chartvendor"
+	"istio.io/istio/pkg/test/deployment/postrender"
 	"istio.io/istio/pkg/test/kube"
 	"istio.io/istio/pkg/test/scopes"
-	"istio.io/istio/pkg/test/shell"
-)
-
-const (
-	namespaceTemplate = `apiVersion: v1
-kind: Namespace
-metadata:
-  name: %s
-  labels:
-    istio-injection: disabled
-`
 )
 
 // HelmConfig configuration for a Helm-based deployment.
@@ -44,13 +43,50 @@ type HelmConfig struct {
 	WorkDir   string
 	ChartDir  string
 
+	// ChartRef, if set, is the alias of a chart vendored into Chartfile by
+	// pkg/test/deployment/chartvendor. It is only consulted when ChartDir is empty.
+	ChartRef  string
+	Chartfile *chartvendor.Chartfile
+
 	// Can be either a file name under ChartDir or an absolute file path.
 	ValuesFile string
 	Values     map[string]string
+
+	// PostRenderers are applied in order to the rendered manifest before it is written and
+	// applied. A postrender.NamespacePostRenderer for Namespace is always applied first.
+	PostRenderers []postrender.PostRenderer
+
+	// HelmEnv, if set, isolates where chart vendoring caches downloaded chart tarballs. Use
+	// NewIsolatedHelmEnv for tests and NewSharedHelmEnv to reuse a cache across a suite.
+	HelmEnv *HelmEnv
 }
 
 // NewHelmDeployment creates a new Helm-based deployment instance.
-func NewHelmDeployment(c HelmConfig) (*Instance, error) {
+func NewHelmDeployment(c HelmConfig, opts ...HelmOption) (*Instance, error) {
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	if c.ChartDir == "" && c.ChartRef != "" {
+		if c.Chartfile == nil {
+			return nil, fmt.Errorf("ChartRef %s set without a Chartfile to resolve it against", c.ChartRef)
+		}
+		if c.HelmEnv != nil {
+			if c.Chartfile.RepositoryCacheDir == "" {
+				c.Chartfile.RepositoryCacheDir = c.HelmEnv.RepositoryCacheDir
+			}
+			if c.Chartfile.RepositoryConfigFile == "" {
+				c.Chartfile.RepositoryConfigFile = c.HelmEnv.RepositoryConfigFile
+			}
+			if c.Chartfile.VendorDir == "" {
+				c.Chartfile.VendorDir = c.HelmEnv.DataDir
+			}
+		}
+		if c.ChartDir = c.Chartfile.Dir(c.ChartRef); c.ChartDir == "" {
+			return nil, fmt.Errorf("chart alias %s not found in Chartfile", c.ChartRef)
+		}
+	}
+
 	// Define a deployment name for Helm.
 	deploymentName := fmt.Sprintf("%s-%v", c.Namespace, time.Now().UnixNano())
 	scopes.CI.Infof("Generated Helm Instance name: %s", deploymentName)
@@ -59,10 +95,12 @@ func NewHelmDeployment(c HelmConfig) (*Instance, error) {
 
 	// Convert the valuesFile to an absolute file path.
 	valuesFile := c.ValuesFile
-	if _, err := os.Stat(valuesFile); os.IsNotExist(err) {
-		valuesFile = filepath.Join(c.ChartDir, valuesFile)
+	if valuesFile != "" {
 		if _, err := os.Stat(valuesFile); os.IsNotExist(err) {
-			return nil, err
+			valuesFile = filepath.Join(c.ChartDir, valuesFile)
+			if _, err := os.Stat(valuesFile); os.IsNotExist(err) {
+				return nil, err
+			}
 		}
 	}
 
@@ -78,13 +116,15 @@ func NewHelmDeployment(c HelmConfig) (*Instance, error) {
 		return nil, fmt.Errorf("chart generation failed: %v", err)
 	}
 
-	// TODO: This is Istio deployment specific. We may need to remove/reconcile this as a parameter
-	// when we support Helm deployment of non-Istio artifacts.
-	namespaceData := fmt.Sprintf(namespaceTemplate, c.Namespace)
-
-	generatedYaml = namespaceData + generatedYaml
+	renderers := append([]postrender.PostRenderer{postrender.NamespacePostRenderer{Namespace: c.Namespace}}, c.PostRenderers...)
+	renderedBytes := []byte(generatedYaml)
+	for _, r := range renderers {
+		if renderedBytes, err = r.Render(renderedBytes); err != nil {
+			return nil, fmt.Errorf("post-render failed: %v", err)
+		}
+	}
 
-	if err = ioutil.WriteFile(yamlFilePath, []byte(generatedYaml), os.ModePerm); err != nil {
+	if err = ioutil.WriteFile(yamlFilePath, renderedBytes, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("unable to write helm generated yaml: %v", err)
 	}
 
@@ -92,52 +132,77 @@ func NewHelmDeployment(c HelmConfig) (*Instance, error) {
 	return NewYamlDeployment(c.Namespace, yamlFilePath), nil
 }
 
-// HelmTemplate calls "helm template".
+// HelmTemplate renders the chart at chartDir in-process using the Helm Go SDK, equivalent to
+// running "helm template" but without shelling out to the helm binary. Values are merged in
+// precedence order: the chart's own values.yaml, then valuesFile, then values.
 func HelmTemplate(deploymentName, namespace, chartDir, workDir, valuesFile string, values map[string]string) (string, error) {
-	// Apply the overrides for the values file.
-	valuesString := ""
-	for k, v := range values {
-		valuesString += fmt.Sprintf(" --set %s=%s", k, v)
+	chrt, err := loader.LoadDir(chartDir)
+	if err != nil {
+		return "", fmt.Errorf("failed loading chart %s: %v", chartDir, err)
 	}
 
-	valuesFileString := ""
+	overrides := map[string]interface{}{}
 	if valuesFile != "" {
-		valuesFileString = fmt.Sprintf("--values %s", valuesFile)
+		b, err := ioutil.ReadFile(valuesFile)
+		if err != nil {
+			return "", fmt.Errorf("failed reading values file %s: %v", valuesFile, err)
+		}
+		if err := yaml.Unmarshal(b, &overrides); err != nil {
+			return "", fmt.Errorf("failed parsing values file %s: %v", valuesFile, err)
+		}
 	}
 
-	helmRepoDir := filepath.Join(workDir, "helmrepo")
-	chartBuildDir := filepath.Join(workDir, "charts")
-	if err := os.MkdirAll(helmRepoDir, os.ModePerm); err != nil {
-		return "", err
-	}
-	if err := os.MkdirAll(chartBuildDir, os.ModePerm); err != nil {
-		return "", err
+	// Apply the --set-style overrides last so they take precedence over the values file.
+	for k, v := range values {
+		if err := strvals.ParseInto(fmt.Sprintf("%s=%s", k, v), overrides); err != nil {
+			return "", fmt.Errorf("failed parsing value override %s=%s: %v", k, v, err)
+		}
 	}
 
-	// Initialize the helm (but do not install tiller).
-	if _, err := exec(fmt.Sprintf("helm --home %s init --client-only", helmRepoDir)); err != nil {
-		return "", err
+	mergedValues, err := chartutil.CoalesceValues(chrt, overrides)
+	if err != nil {
+		return "", fmt.Errorf("failed merging values for chart %s: %v", chartDir, err)
 	}
 
-	// Adding cni dependency as a workaround for now.
-	if _, err := exec(fmt.Sprintf("helm --home %s repo add istio.io %s",
-		helmRepoDir, "https://storage.googleapis.com/istio-prerelease/daily-build/master-latest-daily/charts")); err != nil {
-		return "", err
+	renderValues, err := chartutil.ToRenderValues(chrt, mergedValues, chartutil.ReleaseOptions{
+		Name:      deploymentName,
+		Namespace: namespace,
+	}, chartutil.DefaultCapabilities)
+	if err != nil {
+		return "", fmt.Errorf("failed building render values for chart %s: %v", chartDir, err)
 	}
 
-	// Package the chart dir.
-	if _, err := exec(fmt.Sprintf("helm --home %s package -u %s -d %s", helmRepoDir, chartDir, chartBuildDir)); err != nil {
-		return "", err
+	rendered, err := engine.Render(chrt, renderValues)
+	if err != nil {
+		return "", fmt.Errorf("failed rendering chart %s: %v", chartDir, err)
 	}
-	return exec(fmt.Sprintf("helm --home %s template %s --name %s --namespace %s %s %s",
-		helmRepoDir, chartDir, deploymentName, namespace, valuesFileString, valuesString))
+
+	return joinManifests(rendered), nil
 }
 
-func exec(cmd string) (string, error) {
-	scopes.CI.Infof("executing: %s", cmd)
-	str, err := shell.Execute(cmd)
-	if err != nil {
-		scopes.CI.Errorf("failed executing command (%s): %v: %s", cmd, err, str)
+// joinManifests concatenates the rendered templates (skipping NOTES.txt and empty templates) in a
+// deterministic order so that callers get stable output across runs. Each template is written as
+// its own "---"-delimited YAML document, matching what "helm template" itself emits, so that
+// charts with more than one template file don't collapse into a single, invalid document.
+func joinManifests(rendered map[string]string) string {
+	names := make([]string, 0, len(rendered))
+	for name := range rendered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		if filepath.Base(name) == "NOTES.txt" {
+			continue
+		}
+		content := strings.TrimSpace(rendered[name])
+		if content == "" {
+			continue
+		}
+		b.WriteString("---\n")
+		b.WriteString(content)
+		b.WriteString("\n")
 	}
-	return str, err
+	return b.String()
 }
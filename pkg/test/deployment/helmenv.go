@@ -0,0 +1,114 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package deployment
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// HelmEnv isolates the on-disk state a HelmConfig deployment's chart vendoring reads and writes,
+// modeled after Helm's own XDG base-directory layout. Sharing a HelmEnv across deployments lets
+// chartvendor reuse downloaded chart tarballs and repo registrations instead of re-fetching or
+// re-registering them for every deployment; giving each test its own HelmEnv keeps concurrent test
+// runs from stepping on each other's state. Repo indexes are not cached: every Vendor call fetches
+// them again.
+type HelmEnv struct {
+	// CacheDir is the XDG cache home analog: non-essential, re-fetchable data - currently just
+	// downloaded chart tarballs - lives under here, in RepositoryCacheDir.
+	CacheDir string
+
+	// ConfigDir is the XDG config home analog: small, user-editable configuration - currently just
+	// RepositoryConfigFile - lives here.
+	ConfigDir string
+
+	// DataDir is the XDG data home analog: used as the default Chartfile.VendorDir for a
+	// HelmConfig's Chartfile when it doesn't set one explicitly, so vendored chart contents land
+	// somewhere owned by this HelmEnv. A Chartfile returned by chartvendor.Load always has
+	// VendorDir set to the manifest's directory, so DataDir does not replace that.
+	DataDir string
+
+	// RepositoryConfigFile is the repositories.yaml chartvendor uses to track which chart repos
+	// have already been registered, so a repo already known to this env is never re-registered.
+	RepositoryConfigFile string
+
+	// RepositoryCacheDir is where chartvendor caches downloaded chart tarballs, keyed by chart name
+	// and version. It is wired into Chartfile.RepositoryCacheDir by NewHelmDeployment.
+	RepositoryCacheDir string
+}
+
+func newHelmEnv(base string) *HelmEnv {
+	cacheDir := filepath.Join(base, "cache")
+	configDir := filepath.Join(base, "config")
+	return &HelmEnv{
+		CacheDir:             cacheDir,
+		ConfigDir:            configDir,
+		DataDir:              filepath.Join(base, "data"),
+		RepositoryConfigFile: filepath.Join(configDir, "repositories.yaml"),
+		RepositoryCacheDir:   filepath.Join(cacheDir, "repository"),
+	}
+}
+
+func (e *HelmEnv) dirs() []string {
+	return []string{e.CacheDir, e.ConfigDir, e.DataDir, e.RepositoryCacheDir}
+}
+
+// NewIsolatedHelmEnv returns a HelmEnv rooted at a fresh temporary directory, removed
+// automatically when t completes. Use this so concurrent tests never share chart cache state.
+func NewIsolatedHelmEnv(t testing.TB) *HelmEnv {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "helmenv-")
+	if err != nil {
+		t.Fatalf("failed creating isolated helm env: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	env := newHelmEnv(dir)
+	for _, d := range env.dirs() {
+		if err := os.MkdirAll(d, os.ModePerm); err != nil {
+			t.Fatalf("failed initializing isolated helm env: %v", err)
+		}
+	}
+	return env
+}
+
+// NewSharedHelmEnv returns a HelmEnv rooted at dir, without registering any cleanup, so that CI
+// can reuse a chart cache across an entire test suite invocation.
+func NewSharedHelmEnv(dir string) (*HelmEnv, error) {
+	env := newHelmEnv(dir)
+	for _, d := range env.dirs() {
+		if err := os.MkdirAll(d, os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+// HelmOption customizes a HelmConfig before NewHelmDeployment uses it.
+type HelmOption func(*HelmConfig)
+
+// WithHelmEnv configures the HelmEnv a deployment's chart vendoring uses for caching and repo
+// registration, avoiding redundant downloads and re-registrations across deployments that share
+// env.
+func WithHelmEnv(env *HelmEnv) HelmOption {
+	return func(c *HelmConfig) {
+		c.HelmEnv = env
+	}
+}
@@ -0,0 +1,48 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package deployment
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNewIsolatedHelmEnv(t *testing.T) {
+	env := NewIsolatedHelmEnv(t)
+
+	for _, dir := range []string{env.CacheDir, env.ConfigDir, env.DataDir, env.RepositoryCacheDir} {
+		if dir == "" {
+			t.Fatal("HelmEnv left a directory field unset")
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			t.Fatalf("HelmEnv directory %s was not created: %v", dir, err)
+		}
+	}
+
+	if env.RepositoryConfigFile == "" {
+		t.Fatal("RepositoryConfigFile was not set")
+	}
+}
+
+func TestWithHelmEnv(t *testing.T) {
+	env := NewIsolatedHelmEnv(t)
+
+	var c HelmConfig
+	WithHelmEnv(env)(&c)
+
+	if c.HelmEnv != env {
+		t.Fatalf("WithHelmEnv did not set HelmConfig.HelmEnv to the given env")
+	}
+}
@@ -0,0 +1,196 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package deployment
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	"sigs.k8s.io/yaml"
+
+	"istio.io/istio/pkg/test/deployment/postrender"
+	"istio.io/istio/pkg/test/kube"
+	"istio.io/istio/pkg/test/scopes"
+)
+
+// HelmComponentConfig describes a Helm-based component of a ManifestDeployment.
+type HelmComponentConfig struct {
+	ChartDir   string            `json:"chartDir"`
+	ValuesFile string            `json:"valuesFile"`
+	Values     map[string]string `json:"values"`
+	Namespace  string            `json:"namespace"`
+}
+
+// YamlComponentConfig describes a raw-manifest component of a ManifestDeployment. Path may be a
+// local file path or an http(s) URL.
+type YamlComponentConfig struct {
+	Path      string `json:"path"`
+	Namespace string `json:"namespace"`
+}
+
+// componentConfig is a single entry of an install manifest: exactly one of Helm or Yaml is set.
+type componentConfig struct {
+	Name string               `json:"name"`
+	Helm *HelmComponentConfig `json:"helm,omitempty"`
+	Yaml *YamlComponentConfig `json:"yaml,omitempty"`
+}
+
+// installManifest is the top-level, parsed form of a ManifestDeployment's YAML file.
+type installManifest struct {
+	Components []componentConfig `json:"components"`
+}
+
+// ManifestDeployment installs an ordered list of components - Helm charts and/or raw manifests -
+// declared in a single install manifest file. Unlike HelmConfig, which is Istio-specific, it lets
+// test authors compose Istio with CNI, add-ons, and applications from one file.
+//
+// ManifestDeployment intentionally exposes its own Deploy/Delete rather than aggregating its
+// components into a single *Instance: components are installed/deleted one at a time, in
+// declaration/reverse order, rather than all at once the way a single Instance would.
+type ManifestDeployment struct {
+	workDir    string
+	components []namedInstance
+}
+
+type namedInstance struct {
+	name     string
+	instance *Instance
+}
+
+// NewManifestDeployment parses the install manifest at path and renders every declared component,
+// returning a ManifestDeployment that installs and tears down all of them together. It takes an
+// explicit workDir (unlike HelmConfig, which also has WorkDir) because rendering Helm components
+// and localizing yaml components both need somewhere to write their output, and returns a
+// *ManifestDeployment rather than an aggregate *Instance so that Deploy/Delete can sequence
+// per-component installation and teardown instead of applying everything as one object.
+func NewManifestDeployment(path string, accessor *kube.Accessor, workDir string) (*ManifestDeployment, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading install manifest %s: %v", path, err)
+	}
+
+	var m installManifest
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("failed parsing install manifest %s: %v", path, err)
+	}
+
+	d := &ManifestDeployment{workDir: workDir}
+	for _, c := range m.Components {
+		instance, err := newComponentInstance(c, accessor, workDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed preparing component %s: %v", c.Name, err)
+		}
+		d.components = append(d.components, namedInstance{name: c.Name, instance: instance})
+	}
+	return d, nil
+}
+
+func newComponentInstance(c componentConfig, accessor *kube.Accessor, workDir string) (*Instance, error) {
+	switch {
+	case c.Helm != nil:
+		return NewHelmDeployment(HelmConfig{
+			Accessor:   accessor,
+			Namespace:  c.Helm.Namespace,
+			WorkDir:    workDir,
+			ChartDir:   c.Helm.ChartDir,
+			ValuesFile: c.Helm.ValuesFile,
+			Values:     c.Helm.Values,
+		})
+	case c.Yaml != nil:
+		yamlFilePath, err := localizeYaml(c.Yaml.Path, workDir, c.Name)
+		if err != nil {
+			return nil, err
+		}
+		merged, err := ioutil.ReadFile(yamlFilePath)
+		if err != nil {
+			return nil, err
+		}
+		combined, err := postrender.NamespacePostRenderer{Namespace: c.Yaml.Namespace}.Render(merged)
+		if err != nil {
+			return nil, fmt.Errorf("failed injecting namespace into component %s: %v", c.Name, err)
+		}
+		if err := ioutil.WriteFile(yamlFilePath, combined, os.ModePerm); err != nil {
+			return nil, err
+		}
+		return NewYamlDeployment(c.Yaml.Namespace, yamlFilePath), nil
+	default:
+		return nil, fmt.Errorf("component %s has neither a helm nor a yaml block", c.Name)
+	}
+}
+
+// localizeYaml makes raw manifest content available as a local file under workDir, owned by this
+// deployment, so it can be handed to NewYamlDeployment and later mutated (e.g. to inject a
+// namespace) without ever touching the caller's original file - p may be a local path or an
+// http(s) URL.
+func localizeYaml(p, workDir, name string) (string, error) {
+	var b []byte
+
+	u, err := url.Parse(p)
+	if err == nil && u.Scheme != "" {
+		resp, err := http.Get(p)
+		if err != nil {
+			return "", fmt.Errorf("failed fetching manifest %s: %v", p, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("failed fetching manifest %s: unexpected status %s", p, resp.Status)
+		}
+		if b, err = ioutil.ReadAll(resp.Body); err != nil {
+			return "", err
+		}
+	} else {
+		if b, err = ioutil.ReadFile(p); err != nil {
+			return "", fmt.Errorf("failed reading manifest %s: %v", p, err)
+		}
+	}
+
+	localPath := path.Join(workDir, name+".yaml")
+	if err := ioutil.WriteFile(localPath, b, os.ModePerm); err != nil {
+		return "", err
+	}
+	return localPath, nil
+}
+
+// Deploy installs every component in declaration order, one at a time: each component's
+// Instance.Deploy call must return before the next component is applied, so a component that
+// depends on an earlier one (e.g. an add-on chart that assumes Istio's CRDs already exist) is
+// only applied once its dependency's Deploy call has completed.
+func (d *ManifestDeployment) Deploy() error {
+	for _, c := range d.components {
+		scopes.CI.Infof("Deploying manifest component: %s", c.name)
+		if err := c.instance.Deploy(); err != nil {
+			return fmt.Errorf("failed deploying component %s: %v", c.name, err)
+		}
+	}
+	return nil
+}
+
+// Delete tears down every component in reverse declaration order.
+func (d *ManifestDeployment) Delete() error {
+	var lastErr error
+	for i := len(d.components) - 1; i >= 0; i-- {
+		c := d.components[i]
+		scopes.CI.Infof("Deleting manifest component: %s", c.name)
+		if err := c.instance.Delete(); err != nil {
+			scopes.CI.Errorf("failed deleting component %s: %v", c.name, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,108 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package deployment
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestInstallManifestParsing(t *testing.T) {
+	raw := `
+components:
+- name: istio
+  helm:
+    chartDir: /charts/istio
+    valuesFile: values-test.yaml
+    values:
+      global.proxy.image: proxyv2
+    namespace: istio-system
+- name: bookinfo
+  yaml:
+    path: /manifests/bookinfo.yaml
+    namespace: default
+`
+	var m installManifest
+	if err := yaml.Unmarshal([]byte(raw), &m); err != nil {
+		t.Fatalf("failed parsing install manifest: %v", err)
+	}
+
+	if len(m.Components) != 2 {
+		t.Fatalf("got %d components, want 2", len(m.Components))
+	}
+
+	istio := m.Components[0]
+	if istio.Name != "istio" || istio.Helm == nil || istio.Yaml != nil {
+		t.Fatalf("component 0 parsed incorrectly: %#v", istio)
+	}
+	if istio.Helm.ChartDir != "/charts/istio" || istio.Helm.Namespace != "istio-system" {
+		t.Errorf("helm component fields parsed incorrectly: %#v", istio.Helm)
+	}
+	if istio.Helm.Values["global.proxy.image"] != "proxyv2" {
+		t.Errorf("helm component values parsed incorrectly: %#v", istio.Helm.Values)
+	}
+
+	bookinfo := m.Components[1]
+	if bookinfo.Name != "bookinfo" || bookinfo.Yaml == nil || bookinfo.Helm != nil {
+		t.Fatalf("component 1 parsed incorrectly: %#v", bookinfo)
+	}
+	if bookinfo.Yaml.Path != "/manifests/bookinfo.yaml" || bookinfo.Yaml.Namespace != "default" {
+		t.Errorf("yaml component fields parsed incorrectly: %#v", bookinfo.Yaml)
+	}
+}
+
+func TestLocalizeYamlCopiesLocalPathIntoWorkDir(t *testing.T) {
+	srcDir := t.TempDir()
+	workDir := t.TempDir()
+
+	srcPath := filepath.Join(srcDir, "bookinfo.yaml")
+	const content = "kind: Deployment\nmetadata:\n  name: foo\n"
+	if err := ioutil.WriteFile(srcPath, []byte(content), os.ModePerm); err != nil {
+		t.Fatalf("failed writing source manifest: %v", err)
+	}
+
+	got, err := localizeYaml(srcPath, workDir, "bookinfo")
+	if err != nil {
+		t.Fatalf("localizeYaml: unexpected error: %v", err)
+	}
+
+	if got == srcPath {
+		t.Fatalf("localizeYaml returned the source path unchanged; it must return a copy under workDir")
+	}
+	if filepath.Dir(got) != workDir {
+		t.Errorf("localizeYaml: copy %s was not placed under workDir %s", got, workDir)
+	}
+
+	gotContent, err := ioutil.ReadFile(got)
+	if err != nil {
+		t.Fatalf("failed reading localized manifest: %v", err)
+	}
+	if string(gotContent) != content {
+		t.Errorf("localized manifest content = %q, want %q", gotContent, content)
+	}
+
+	// The source file must be left untouched.
+	srcContent, err := ioutil.ReadFile(srcPath)
+	if err != nil {
+		t.Fatalf("failed reading source manifest: %v", err)
+	}
+	if string(srcContent) != content {
+		t.Errorf("localizeYaml mutated the caller's source file: got %q, want %q", srcContent, content)
+	}
+}
@@ -0,0 +1,75 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package postrender
+
+import (
+	"encoding/json"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"sigs.k8s.io/yaml"
+)
+
+// JSONPatchTarget selects the manifest(s) a Patch applies to. Empty fields match anything.
+type JSONPatchTarget struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Patch     json.RawMessage
+}
+
+// JSONPatchPostRenderer applies RFC-6902 JSON patches to specific (kind, name, namespace)
+// targets in a rendered manifest.
+type JSONPatchPostRenderer struct {
+	Patches []JSONPatchTarget
+}
+
+// Render applies every matching patch to the documents in in.
+func (r JSONPatchPostRenderer) Render(in []byte) ([]byte, error) {
+	docs := splitDocuments(in)
+	for i, raw := range docs {
+		d, err := parseDocument(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing manifest document: %v", err)
+		}
+
+		for _, t := range r.Patches {
+			if !d.matches(t.Kind, t.Name, t.Namespace) {
+				continue
+			}
+
+			patch, err := jsonpatch.DecodePatch(t.Patch)
+			if err != nil {
+				return nil, fmt.Errorf("failed decoding JSON patch for %s/%s: %v", t.Kind, t.Name, err)
+			}
+
+			docJSON, err := yaml.YAMLToJSON([]byte(raw))
+			if err != nil {
+				return nil, fmt.Errorf("failed converting manifest to JSON: %v", err)
+			}
+			patchedJSON, err := patch.Apply(docJSON)
+			if err != nil {
+				return nil, fmt.Errorf("failed applying JSON patch to %s/%s: %v", t.Kind, t.Name, err)
+			}
+			patchedYAML, err := yaml.JSONToYAML(patchedJSON)
+			if err != nil {
+				return nil, fmt.Errorf("failed converting patched manifest back to YAML: %v", err)
+			}
+			raw = string(patchedYAML)
+		}
+		docs[i] = raw
+	}
+	return joinDocuments(docs), nil
+}
@@ -0,0 +1,52 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package postrender
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// baseResourcesFile is the name the rendered manifest is written under inside OverlayDir before
+// "kustomize build" runs. The overlay's kustomization.yaml must list it as a resource.
+const baseResourcesFile = ".helm-chart-resources.yaml"
+
+// KustomizePostRenderer runs "kustomize build" against OverlayDir, after writing the input
+// manifest into OverlayDir as baseResourcesFile so the overlay's kustomization.yaml can patch it.
+type KustomizePostRenderer struct {
+	OverlayDir string
+}
+
+// Render writes in to OverlayDir and returns the output of "kustomize build".
+func (r KustomizePostRenderer) Render(in []byte) ([]byte, error) {
+	resourcesFile := filepath.Join(r.OverlayDir, baseResourcesFile)
+	if err := ioutil.WriteFile(resourcesFile, in, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed writing base manifest for kustomize: %v", err)
+	}
+	defer os.Remove(resourcesFile)
+
+	var out, stderr bytes.Buffer
+	cmd := exec.Command("kustomize", "build", r.OverlayDir)
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("kustomize build %s failed: %v: %s", r.OverlayDir, err, stderr.String())
+	}
+	return out.Bytes(), nil
+}
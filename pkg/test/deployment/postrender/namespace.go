@@ -0,0 +1,43 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package postrender
+
+import (
+	"fmt"
+	"strings"
+)
+
+const namespaceTemplate = `apiVersion: v1
+kind: Namespace
+metadata:
+  name: %s
+  labels:
+    istio-injection: disabled
+`
+
+// NamespacePostRenderer prepends a Namespace manifest for Namespace to its input. It is the
+// default post-render step HelmConfig applies, replacing what used to be a hardcoded step in
+// NewHelmDeployment.
+type NamespacePostRenderer struct {
+	Namespace string
+}
+
+// Render prepends the Namespace manifest to in, as its own "---"-delimited YAML document so it
+// doesn't merge into whatever resource happens to come first in in.
+func (r NamespacePostRenderer) Render(in []byte) ([]byte, error) {
+	ns := fmt.Sprintf(namespaceTemplate, r.Namespace)
+	rest := strings.TrimPrefix(string(in), "---\n")
+	return []byte(ns + "---\n" + rest), nil
+}
@@ -0,0 +1,47 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package postrender
+
+import "testing"
+
+func TestNamespacePostRendererSeparatesDocuments(t *testing.T) {
+	in := "---\nkind: Deployment\nmetadata:\n  name: foo\n"
+
+	out, err := NamespacePostRenderer{Namespace: "istio-system"}.Render([]byte(in))
+	if err != nil {
+		t.Fatalf("Render: unexpected error: %v", err)
+	}
+
+	docs := splitDocuments(out)
+	if len(docs) != 2 {
+		t.Fatalf("Render produced %d documents (wanted Namespace + Deployment kept separate): %q", len(docs), out)
+	}
+
+	ns, err := parseDocument(docs[0])
+	if err != nil {
+		t.Fatalf("parseDocument(namespace doc): unexpected error: %v", err)
+	}
+	if !ns.matches("Namespace", "istio-system", "") {
+		t.Errorf("first document is not the injected Namespace: %q", docs[0])
+	}
+
+	dep, err := parseDocument(docs[1])
+	if err != nil {
+		t.Fatalf("parseDocument(deployment doc): unexpected error: %v", err)
+	}
+	if !dep.matches("Deployment", "foo", "") {
+		t.Errorf("second document lost its identity after namespace injection: %q", docs[1])
+	}
+}
@@ -0,0 +1,25 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package postrender provides HelmConfig.PostRenderers implementations that transform a
+// rendered chart's manifest YAML before it is applied, similar to how chartify and helmfile
+// let callers patch a chart's output without forking it.
+package postrender
+
+// PostRenderer transforms rendered manifest YAML. HelmConfig.PostRenderers are invoked in order
+// on the output of HelmTemplate, each receiving the previous renderer's output; the first one
+// receives it after the default NamespacePostRenderer has prepended the Namespace manifest.
+type PostRenderer interface {
+	Render(in []byte) ([]byte, error)
+}
@@ -0,0 +1,86 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package postrender
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/yaml"
+)
+
+// StrategicMergePatch is a single strategic-merge-style patch targeted at a (kind, name,
+// namespace) selector. Unlike JSONPatchTarget, Patch is itself a partial manifest: maps are
+// merged key-by-key and other values (including lists) replace the original wholesale.
+type StrategicMergePatch struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Patch     string
+}
+
+// StrategicMergePostRenderer merges StrategicMergePatch documents into matching manifests.
+type StrategicMergePostRenderer struct {
+	Patches []StrategicMergePatch
+}
+
+// Render merges every matching patch into the documents in in.
+func (r StrategicMergePostRenderer) Render(in []byte) ([]byte, error) {
+	docs := splitDocuments(in)
+	for i, raw := range docs {
+		d, err := parseDocument(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing manifest document: %v", err)
+		}
+
+		var base map[string]interface{}
+		if err := yaml.Unmarshal([]byte(raw), &base); err != nil {
+			return nil, fmt.Errorf("failed parsing manifest document: %v", err)
+		}
+
+		for _, t := range r.Patches {
+			if !d.matches(t.Kind, t.Name, t.Namespace) {
+				continue
+			}
+
+			var patch map[string]interface{}
+			if err := yaml.Unmarshal([]byte(t.Patch), &patch); err != nil {
+				return nil, fmt.Errorf("failed parsing strategic merge patch for %s/%s: %v", t.Kind, t.Name, err)
+			}
+			base = mergeMaps(base, patch)
+		}
+
+		merged, err := yaml.Marshal(base)
+		if err != nil {
+			return nil, fmt.Errorf("failed marshaling merged manifest: %v", err)
+		}
+		docs[i] = string(merged)
+	}
+	return joinDocuments(docs), nil
+}
+
+// mergeMaps recursively merges patch into base. Nested maps are merged key-by-key; any other
+// value, including lists, is replaced wholesale by the patch's value.
+func mergeMaps(base, patch map[string]interface{}) map[string]interface{} {
+	for k, v := range patch {
+		if patchMap, ok := v.(map[string]interface{}); ok {
+			if baseMap, ok := base[k].(map[string]interface{}); ok {
+				base[k] = mergeMaps(baseMap, patchMap)
+				continue
+			}
+		}
+		base[k] = v
+	}
+	return base
+}
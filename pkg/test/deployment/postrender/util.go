@@ -0,0 +1,83 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package postrender
+
+import (
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// document is a single parsed Kubernetes manifest document.
+type document struct {
+	raw  []byte
+	meta struct {
+		Kind     string `json:"kind"`
+		Metadata struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+	}
+}
+
+func (d document) matches(kind, name, namespace string) bool {
+	if kind != "" && d.meta.Kind != kind {
+		return false
+	}
+	if name != "" && d.meta.Metadata.Name != name {
+		return false
+	}
+	if namespace != "" && d.meta.Metadata.Namespace != namespace {
+		return false
+	}
+	return true
+}
+
+// splitDocuments splits a multi-document YAML manifest on "---" separators, dropping empty
+// documents produced by leading/trailing separators. A leading separator (as HelmTemplate's
+// output always has) is stripped before splitting so it doesn't leak into the first document.
+func splitDocuments(in []byte) []string {
+	s := strings.TrimPrefix(strings.TrimLeft(string(in), "\n"), "---\n")
+	parts := strings.Split(s, "\n---\n")
+	docs := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		docs = append(docs, p)
+	}
+	return docs
+}
+
+// joinDocuments is the inverse of splitDocuments: each document is written back out as its own
+// "---"-delimited YAML document.
+func joinDocuments(docs []string) []byte {
+	var b strings.Builder
+	for _, d := range docs {
+		b.WriteString("---\n")
+		b.WriteString(strings.TrimSpace(d))
+		b.WriteString("\n")
+	}
+	return []byte(b.String())
+}
+
+func parseDocument(raw string) (document, error) {
+	d := document{raw: []byte(raw)}
+	if err := yaml.Unmarshal([]byte(raw), &d.meta); err != nil {
+		return document{}, err
+	}
+	return d, nil
+}
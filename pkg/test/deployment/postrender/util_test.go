@@ -0,0 +1,138 @@
+//  Copyright 2018 Istio Authors
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package postrender
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitDocuments(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{
+			name: "leading separator, two documents",
+			in:   "---\nkind: A\n---\nkind: B\n",
+			want: []string{"kind: A", "kind: B"},
+		},
+		{
+			name: "no leading separator",
+			in:   "kind: A\n---\nkind: B\n",
+			want: []string{"kind: A", "kind: B"},
+		},
+		{
+			name: "single document",
+			in:   "---\nkind: A\n",
+			want: []string{"kind: A"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitDocuments([]byte(tc.in))
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("splitDocuments(%q) = %#v, want %#v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSplitJoinDocumentsRoundTrip(t *testing.T) {
+	in := "---\nkind: A\nmetadata:\n  name: a\n---\nkind: B\nmetadata:\n  name: b\n"
+
+	docs := splitDocuments([]byte(in))
+	if len(docs) != 2 {
+		t.Fatalf("splitDocuments: got %d documents, want 2", len(docs))
+	}
+
+	rejoined := joinDocuments(docs)
+	redocs := splitDocuments(rejoined)
+	if !reflect.DeepEqual(docs, redocs) {
+		t.Errorf("splitDocuments(joinDocuments(docs)) = %#v, want %#v", redocs, docs)
+	}
+}
+
+func TestDocumentMatches(t *testing.T) {
+	d, err := parseDocument("kind: Namespace\nmetadata:\n  name: istio-system\n")
+	if err != nil {
+		t.Fatalf("parseDocument: unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		kind      string
+		objName   string
+		namespace string
+		want      bool
+	}{
+		{name: "matches kind and name", kind: "Namespace", objName: "istio-system", want: true},
+		{name: "wrong kind", kind: "Deployment", want: false},
+		{name: "wrong name", objName: "other", want: false},
+		{name: "empty selector matches anything", want: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := d.matches(tc.kind, tc.objName, tc.namespace); got != tc.want {
+				t.Errorf("matches(%q, %q, %q) = %v, want %v", tc.kind, tc.objName, tc.namespace, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMergeMaps(t *testing.T) {
+	base := map[string]interface{}{
+		"kind": "Deployment",
+		"spec": map[string]interface{}{
+			"replicas": 1,
+			"template": map[string]interface{}{
+				"labels": map[string]interface{}{"app": "foo"},
+			},
+		},
+	}
+	patch := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"replicas": 3,
+		},
+	}
+
+	got := mergeMaps(base, patch)
+
+	if got["spec"].(map[string]interface{})["replicas"] != 3 {
+		t.Errorf("mergeMaps: replicas = %v, want 3", got["spec"].(map[string]interface{})["replicas"])
+	}
+	template, ok := got["spec"].(map[string]interface{})["template"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("mergeMaps: template was dropped by merge: %#v", got)
+	}
+	if labels := template["labels"].(map[string]interface{})["app"]; labels != "foo" {
+		t.Errorf("mergeMaps: unrelated nested key was clobbered, app = %v, want foo", labels)
+	}
+}
+
+func TestMergeMapsReplacesLists(t *testing.T) {
+	base := map[string]interface{}{"items": []interface{}{"a", "b"}}
+	patch := map[string]interface{}{"items": []interface{}{"c"}}
+
+	got := mergeMaps(base, patch)
+
+	want := []interface{}{"c"}
+	if !reflect.DeepEqual(got["items"], want) {
+		t.Errorf("mergeMaps: items = %#v, want lists replaced wholesale with %#v", got["items"], want)
+	}
+}